@@ -4,10 +4,13 @@ package multibuf
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
 )
 
 // MultiBuf provides Read, Close, Seek and Size methods. In addition to that it supports WriterTo interface
@@ -20,6 +23,41 @@ type MultiBuf interface {
 
 	// Size calculates and returns the total size of the reader and not the length remaining.
 	Size() (int64, error)
+
+	// Sum returns the checksum computed while buffering and the algorithm it was computed with.
+	// It returns ErrNoChecksum if WithChecksum was not passed to New or NewWriterOnce.
+	Sum() ([]byte, ChecksumAlgo, error)
+
+	// NewReader returns an independent MultiBuf over the same buffered payload: its own cursor over
+	// the shared mem bytes/pages, and, if the payload spilled to disk, its own read position on the
+	// same *os.File (positioned reads; no new file handle is opened). Useful for fan-out, e.g.
+	// mirroring a request body to several backends.
+	// The returned MultiBuf must be closed independently of the one it was created from; the disk
+	// portion, if any, is only actually released once every MultiBuf sharing it has been closed.
+	NewReader() (MultiBuf, error)
+}
+
+var (
+	// ErrNoDataReady is returned from Reader when Reader is called before any data has been written.
+	ErrNoDataReady = errors.New("mailgun/multibuf: no data ready")
+	// ErrReaderHasBeenCalled is returned from Write or Reader once Reader has already been called.
+	ErrReaderHasBeenCalled = errors.New("mailgun/multibuf: reader has been called")
+	// ErrNoChecksum is returned from Sum when WithChecksum was not passed to New or NewWriterOnce.
+	ErrNoChecksum = errors.New("mailgun/multibuf: no checksum configured")
+	// ErrBitrot is returned from Read or WriteTo when WithVerifyOnRead is set and a full read following
+	// a Seek to the start of the buffer does not match the checksum computed while buffering.
+	ErrBitrot = errors.New("mailgun/multibuf: data does not match the checksum computed while buffering")
+)
+
+// WriterOnce implements write once, read many times writer. Create a WriterOnce and write to it, once Reader()
+// has been called, the internal data is transferred to MultiBuf and this instance of WriterOnce should no
+// longer be used.
+type WriterOnce interface {
+	io.Writer
+	io.Closer
+
+	// Reader transfers all data written to this writer to MultiBuf. If there was no data written it returns an error.
+	Reader() (MultiBuf, error)
 }
 
 // MaxBytes, ignored if set to value >=, if request exceeds the specified limit, the reader will return error,
@@ -40,23 +78,105 @@ func MemBytes(m int64) optionSetter {
 		if m < 0 {
 			return fmt.Errorf("MemBytes should be >= 0")
 		}
-		o.maxSizeBytes = m
+		o.memBytes = m
+		return nil
+	}
+}
+
+// WithPool makes New and NewWriterOnce buffer the in-memory portion of the payload as a sequence of
+// fixed-size pages leased from pool instead of growing one contiguous slice, bounding steady-state
+// allocation for services that buffer many bodies concurrently.
+func WithPool(p *Pool) optionSetter {
+	return func(o *options) error {
+		if p == nil {
+			return fmt.Errorf("pool should not be nil")
+		}
+		o.pool = p
+		return nil
+	}
+}
+
+// WithChecksum makes New and NewWriterOnce compute a checksum of the input with algo while it is
+// being buffered, retrievable afterwards via MultiBuf.Sum.
+func WithChecksum(algo ChecksumAlgo) optionSetter {
+	return func(o *options) error {
+		switch algo {
+		case SHA256, BLAKE2b_256, HighwayHash256:
+			o.checksumAlgo = algo
+			return nil
+		default:
+			return fmt.Errorf("unsupported checksum algorithm %v", algo)
+		}
+	}
+}
+
+// WithStorage makes New and NewWriterOnce spill to storage instead of the default temp-file-on-disk
+// behaviour once the in-memory budget is exhausted. See DirStorage, MemOnlyStorage and
+// EncryptedStorage for the built-in implementations.
+func WithStorage(storage Storage) optionSetter {
+	return func(o *options) error {
+		if storage == nil {
+			return fmt.Errorf("storage should not be nil")
+		}
+		o.storage = storage
 		return nil
 	}
 }
 
+// WithVerifyOnRead makes a buffer created with WithChecksum recompute its checksum whenever it is
+// read in full after a Seek to the start, returning ErrBitrot from Read or WriteTo if the data no
+// longer matches the checksum computed while buffering. It requires WithChecksum to also be set.
+func WithVerifyOnRead(v bool) optionSetter {
+	return func(o *options) error {
+		o.verifyOnRead = v
+		return nil
+	}
+}
+
+// NewWriterOnce returns a WriterOnce that can limit the size of the buffer and persist large buffers to disk.
+// WriterOnce implements write once, read many times writer. Create a WriterOnce and write to it, once Reader()
+// has been called, the internal data is transferred to MultiBuf and this instance of WriterOnce should no
+// longer be used.
+// By default NewWriterOnce returns an unbound buffer that will allow writes of up to 1MB in RAM before it
+// starts buffering to disk. It supports the same functional options as New.
+func NewWriterOnce(setters ...optionSetter) (WriterOnce, error) {
+	o := options{
+		memBytes:     DefaultMemBytes,
+		maxSizeBytes: DefaultMaxSizeBytes,
+		storage:      DirStorage("", "multibuf-"),
+	}
+	for _, s := range setters {
+		if err := s(&o); err != nil {
+			return nil, err
+		}
+	}
+	o.clampMemBytes()
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	w := &writerOnce{o: o}
+	if o.checksumAlgo != ChecksumNone {
+		h, err := newChecksumHash(o.checksumAlgo)
+		if err != nil {
+			return nil, err
+		}
+		w.csHash = h
+	}
+	return w, nil
+}
+
 // New returns MultiBuf that can limit the size of the buffer and persist large buffers to disk.
 // By default New returns unbound buffer that will read up to 1MB in RAM and will start buffering to disk
 // It supports multiple functional optional arguments:
 //
-//    // Buffer up to 1MB in RAM and limit max buffer size to 20MB
-//    multibuf.New(r, multibuf.MemBytes(1024 * 1024), multibuf.MaxBytes(1024 * 1024 * 20))
-//
-//
+//	// Buffer up to 1MB in RAM and limit max buffer size to 20MB
+//	multibuf.New(r, multibuf.MemBytes(1024 * 1024), multibuf.MaxBytes(1024 * 1024 * 20))
 func New(input io.Reader, setters ...optionSetter) (MultiBuf, error) {
 	o := options{
 		memBytes:     DefaultMemBytes,
 		maxSizeBytes: DefaultMaxSizeBytes,
+		storage:      DirStorage("", "multibuf-"),
 	}
 
 	for _, s := range setters {
@@ -64,6 +184,20 @@ func New(input io.Reader, setters ...optionSetter) (MultiBuf, error) {
 			return nil, err
 		}
 	}
+	o.clampMemBytes()
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	var csHash hash.Hash
+	if o.checksumAlgo != ChecksumNone {
+		h, err := newChecksumHash(o.checksumAlgo)
+		if err != nil {
+			return nil, err
+		}
+		csHash = h
+		input = io.TeeReader(input, csHash)
+	}
 
 	memReader := &io.LimitedReader{
 		R: input,      // Read from this reader
@@ -71,44 +205,97 @@ func New(input io.Reader, setters ...optionSetter) (MultiBuf, error) {
 	}
 	readers := make([]io.ReadSeeker, 0, 2)
 
-	buffer, err := ioutil.ReadAll(memReader)
+	memSeg, memLen, err := readIntoMem(memReader, &o)
 	if err != nil {
 		return nil, err
 	}
-	readers = append(readers, bytes.NewReader(buffer))
+	readers = append(readers, memSeg)
 
-	var file *os.File
+	memCloser, hasMemCloser := memSeg.(io.Closer)
+
+	var spill io.ReadWriteSeeker
+	var spillCleanup func() error
 	// This means that we have exceeded all the memory capacity and we will start buffering the body to disk.
-	totalBytes := int64(len(buffer))
+	totalBytes := memLen
 	if memReader.N <= 0 {
-		file, err = ioutil.TempFile("", "multibuf-")
+		spill, spillCleanup, err = o.storage.Create()
 		if err != nil {
+			if hasMemCloser {
+				memCloser.Close()
+			}
 			return nil, err
 		}
-		os.Remove(file.Name())
 
 		readSrc := input
 		if o.maxSizeBytes > 0 {
 			readSrc = &maxReader{R: input, Max: o.maxSizeBytes - o.memBytes}
 		}
 
-		writtenBytes, err := io.Copy(file, readSrc)
+		writtenBytes, err := io.Copy(spill, readSrc)
 		if err != nil {
+			spillCleanup()
+			if hasMemCloser {
+				memCloser.Close()
+			}
 			return nil, err
 		}
 		totalBytes += writtenBytes
-		file.Seek(0, 0)
-		readers = append(readers, file)
+		if _, err := spill.Seek(0, 0); err != nil {
+			spillCleanup()
+			if hasMemCloser {
+				memCloser.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, spill)
 	}
 
-	var cleanupFn cleanupFunc
-	if file != nil {
-		cleanupFn = func() error {
-			file.Close()
-			return nil
+	var memShared *sharedCloser
+	if hasMemCloser {
+		memShared = newSharedCloser(memCloser.Close)
+	}
+	var spillShared *sharedCloser
+	if spillCleanup != nil {
+		spillShared = newSharedCloser(spillCleanup)
+	}
+
+	var cleanupFns []func() error
+	if memShared != nil {
+		cleanupFns = append(cleanupFns, memShared.release)
+	}
+	if spillShared != nil {
+		cleanupFns = append(cleanupFns, spillShared.release)
+	}
+
+	mb := newBuf(totalBytes, combineCleanup(cleanupFns), readers...)
+	mb.memSrc = memSeg.(memSource)
+	mb.spill = spill
+	mb.memShared = memShared
+	mb.spillShared = spillShared
+	mb.checksumAlgo = o.checksumAlgo
+	mb.verifyOnRead = o.verifyOnRead
+	if csHash != nil {
+		mb.checksum = csHash.Sum(nil)
+	}
+	return mb, nil
+}
+
+// readIntoMem buffers r (already capped to the configured mem budget by the caller) into a
+// read-seekable segment: a single contiguous slice by default, or a sequence of pages leased from
+// o.pool when WithPool is set.
+func readIntoMem(r io.Reader, o *options) (io.ReadSeeker, int64, error) {
+	if o.pool != nil {
+		pb := newPoolBuffer(o.pool)
+		if _, err := io.Copy(pb, r); err != nil {
+			return nil, 0, err
 		}
+		return pb, pb.Size(), nil
+	}
+	buffer, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
 	}
-	return newBuf(totalBytes, cleanupFn, readers...), nil
+	return newMemBytes(buffer), int64(len(buffer)), nil
 }
 
 // MaxSizeReachedError is returned when the maximum allowed buffer size is reached when reading
@@ -127,15 +314,109 @@ const (
 	DefaultBufferBytes = 512
 )
 
+// sizer is implemented by the mem segment of a multiReaderSeek (a *memBytes, or a *poolBuffer
+// when WithPool is used; a *bytes.Reader or *pagedCursor for one created by NewReader) so Seek can
+// learn the mem/file boundary without caring which one it is.
+type sizer interface {
+	Size() int64
+}
+
+// memSource is implemented by a multiReaderSeek's mem segment (*memBytes or *poolBuffer) and hands
+// out an independent cursor over the same underlying bytes/pages, which NewReader needs to fan a
+// buffer out to concurrent readers without racing the original's cursor.
+type memSource interface {
+	newReader() io.ReadSeeker
+}
+
+// memBytes is the mem segment backed by a single contiguous slice, read with a *bytes.Reader. The
+// slice is immutable once buffering completes, so newReader can safely hand out further
+// *bytes.Reader instances over it.
+type memBytes struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newMemBytes(data []byte) *memBytes {
+	return &memBytes{Reader: bytes.NewReader(data), data: data}
+}
+
+func (m *memBytes) newReader() io.ReadSeeker {
+	return bytes.NewReader(m.data)
+}
+
+// sharedCloser lets N independent readers release a single underlying resource exactly once, when
+// the last of them has been closed. Used so pages leased from a Pool aren't returned for reuse while
+// a sibling reader created via NewReader is still reading them.
+type sharedCloser struct {
+	mu    sync.Mutex
+	count int
+	close func() error
+}
+
+func newSharedCloser(closeFn func() error) *sharedCloser {
+	return &sharedCloser{count: 1, close: closeFn}
+}
+
+func (s *sharedCloser) retain() *sharedCloser {
+	s.mu.Lock()
+	s.count++
+	s.mu.Unlock()
+	return s
+}
+
+func (s *sharedCloser) release() error {
+	s.mu.Lock()
+	s.count--
+	done := s.count == 0
+	s.mu.Unlock()
+	if done {
+		return s.close()
+	}
+	return nil
+}
+
+// errNegativeSeek is returned when a Seek would result in a negative absolute position.
+var errNegativeSeek = errors.New("multibuf: negative position")
+
+// errUnsupportedWhence is returned by Seek implementations in this package for an unrecognized whence.
+var errUnsupportedWhence = errors.New("multibuf: unsupported whence")
+
+// errNewReaderRequiresFileStorage is returned by NewReader when the buffer's spill segment was
+// produced by a Storage other than one backed by *os.File (e.g. EncryptedStorage or a custom
+// implementation), since only an *os.File can be duplicated into an independent reader.
+var errNewReaderRequiresFileStorage = errors.New("multibuf: NewReader requires an *os.File-backed Storage")
+
 // Constraints:
-//  - Implements io.Reader
-//  - Implements Seek(0, 0)
-//	- Designed for Write once, Read many times.
+//   - Implements io.Reader
+//   - Implements io.Seeker with io.SeekStart, io.SeekCurrent and io.SeekEnd
+//   - Designed for Write once, Read many times.
 type multiReaderSeek struct {
 	length  int64
 	readers []io.ReadSeeker
 	mr      io.Reader
 	cleanup cleanupFunc
+	pos     int64
+
+	// memSrc and spill back NewReader: memSrc hands out an independent cursor over the same mem
+	// bytes/pages, and spill, if non-nil, is the on-disk segment obtained from the configured
+	// Storage. NewReader can only fan out spill when it is backed by an *os.File (the default
+	// DirStorage); other Storage implementations don't support fanning out to multiple readers.
+	// memShared and spillShared, when non-nil, are the shared releases for a pool-backed mem
+	// segment and a disk spill respectively, retained once per reader sharing them.
+	memSrc      memSource
+	spill       io.ReadWriteSeeker
+	memShared   *sharedCloser
+	spillShared *sharedCloser
+
+	// checksumAlgo and checksum are set when New or NewWriterOnce was given WithChecksum; checksum
+	// holds the value computed while the payload was buffered, returned unchanged by Sum.
+	checksumAlgo ChecksumAlgo
+	checksum     []byte
+	// verifyOnRead, copied from the options WithVerifyOnRead was given, re-verifies checksum whenever
+	// Seek(0, io.SeekStart) is followed by a full read. verifyHash is non-nil only for the duration of
+	// such a read: Seek(0, ...) creates it and tees mr.mr through it, Read/WriteTo consume it at EOF.
+	verifyOnRead bool
+	verifyHash   hash.Hash
 }
 
 type cleanupFunc func() error
@@ -167,6 +448,7 @@ func (mr *multiReaderSeek) WriteTo(w io.Writer) (int64, error) {
 	var total int64
 	for {
 		n, err := mr.mr.Read(b)
+		mr.pos += int64(n)
 		// Recommended way is to always handle non 0 reads despite the errors
 		if n > 0 {
 			nw, errw := w.Write(b[:n])
@@ -178,6 +460,9 @@ func (mr *multiReaderSeek) WriteTo(w io.Writer) (int64, error) {
 		}
 		if err != nil {
 			if err == io.EOF {
+				if bitrotErr := mr.checkBitrot(); bitrotErr != nil {
+					return total, bitrotErr
+				}
 				return total, nil
 			}
 			return total, err
@@ -186,36 +471,173 @@ func (mr *multiReaderSeek) WriteTo(w io.Writer) (int64, error) {
 }
 
 func (mr *multiReaderSeek) Read(p []byte) (n int, err error) {
-	return mr.mr.Read(p)
+	n, err = mr.mr.Read(p)
+	mr.pos += int64(n)
+	if err == io.EOF {
+		if bitrotErr := mr.checkBitrot(); bitrotErr != nil {
+			return n, bitrotErr
+		}
+	}
+	return n, err
+}
+
+// checkBitrot consumes verifyHash, if active, comparing what it hashed against the checksum
+// computed while buffering. It is a no-op once called, so it only fires once per Seek(0, ...) pass.
+func (mr *multiReaderSeek) checkBitrot() error {
+	if mr.verifyHash == nil {
+		return nil
+	}
+	h := mr.verifyHash
+	mr.verifyHash = nil
+	if !bytes.Equal(h.Sum(nil), mr.checksum) {
+		return ErrBitrot
+	}
+	return nil
 }
 
 func (mr *multiReaderSeek) Size() (int64, error) {
 	return mr.length, nil
 }
 
+// Sum returns the checksum computed while buffering, and the algorithm used. It returns
+// ErrNoChecksum if WithChecksum was not passed to New or NewWriterOnce.
+func (mr *multiReaderSeek) Sum() ([]byte, ChecksumAlgo, error) {
+	if mr.checksumAlgo == ChecksumNone {
+		return nil, ChecksumNone, ErrNoChecksum
+	}
+	return mr.checksum, mr.checksumAlgo, nil
+}
+
+// NewReader returns an independent MultiBuf sharing this one's underlying mem bytes/pages, and, if
+// present, a fileCursor giving it its own logical offset onto the same on-disk segment. It returns
+// errNewReaderRequiresFileStorage if the buffer spilled to a Storage that isn't *os.File-backed.
+func (mr *multiReaderSeek) NewReader() (MultiBuf, error) {
+	readers := make([]io.ReadSeeker, 0, 2)
+	readers = append(readers, mr.memSrc.newReader())
+
+	var spill io.ReadWriteSeeker
+	var spillShared *sharedCloser
+	if mr.spill != nil {
+		sf, ok := mr.spill.(*os.File)
+		if !ok {
+			return nil, errNewReaderRequiresFileStorage
+		}
+		spill = sf
+		spillShared = mr.spillShared.retain()
+		readers = append(readers, &fileCursor{f: sf})
+	}
+
+	var memShared *sharedCloser
+	var cleanupFns []func() error
+	if mr.memShared != nil {
+		memShared = mr.memShared.retain()
+		cleanupFns = append(cleanupFns, memShared.release)
+	}
+	if spillShared != nil {
+		cleanupFns = append(cleanupFns, spillShared.release)
+	}
+
+	nb := newBuf(mr.length, combineCleanup(cleanupFns), readers...)
+	nb.memSrc = mr.memSrc
+	nb.spill = spill
+	nb.spillShared = spillShared
+	nb.memShared = memShared
+	nb.checksumAlgo = mr.checksumAlgo
+	nb.checksum = mr.checksum
+	nb.verifyOnRead = mr.verifyOnRead
+	return nb, nil
+}
+
+// combineCleanup runs every fn in fns, returning the first error encountered, if any.
+func combineCleanup(fns []func() error) cleanupFunc {
+	if len(fns) == 0 {
+		return nil
+	}
+	return func() error {
+		var firstErr error
+		for _, fn := range fns {
+			if err := fn(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+}
+
+// Seek implements the full io.Seeker contract. The buffer is composed of an in-memory segment
+// (readers[0], implementing sizer) followed optionally by a single spill segment (readers[1], the
+// destination created by the configured Storage, or a fileCursor for a buffer created by NewReader).
+// Seek computes the absolute target position, locates the segment that contains it, seeks every prior
+// segment to its end and every later segment to its start, seeks the containing segment to its sub-offset,
+// and rebuilds mr from the containing segment onward.
 func (mr *multiReaderSeek) Seek(offset int64, whence int) (int64, error) {
-	// TODO: implement other whence
-	// TODO: implement real offsets
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = mr.pos + offset
+	case io.SeekEnd:
+		newPos = mr.length + offset
+	default:
+		return 0, errUnsupportedWhence
+	}
+	if newPos < 0 {
+		return 0, errNegativeSeek
+	}
 
-	if whence != 0 {
-		return 0, fmt.Errorf("multiReaderSeek: unsupported whence")
+	memLen := mr.readers[0].(sizer).Size()
+	segLens := make([]int64, len(mr.readers))
+	segLens[0] = memLen
+	if len(mr.readers) > 1 {
+		segLens[1] = mr.length - memLen
 	}
 
-	if offset != 0 {
-		return 0, fmt.Errorf("multiReaderSeek: unsupported offset")
+	var segStart int64
+	target := 0
+	for i, segLen := range segLens {
+		if newPos < segStart+segLen || i == len(segLens)-1 {
+			target = i
+			break
+		}
+		segStart += segLen
 	}
 
-	for _, seeker := range mr.readers {
-		seeker.Seek(0, 0)
+	for i, seeker := range mr.readers {
+		switch {
+		case i < target:
+			if _, err := seeker.Seek(0, io.SeekEnd); err != nil {
+				return 0, err
+			}
+		case i == target:
+			if _, err := seeker.Seek(newPos-segStart, io.SeekStart); err != nil {
+				return 0, err
+			}
+		default:
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+		}
 	}
 
-	ior := make([]io.Reader, len(mr.readers))
-	for i, arg := range mr.readers {
+	ior := make([]io.Reader, len(mr.readers)-target)
+	for i, arg := range mr.readers[target:] {
 		ior[i] = arg.(io.Reader)
 	}
 	mr.mr = io.MultiReader(ior...)
+	mr.pos = newPos
+	mr.verifyHash = nil
 
-	return 0, nil
+	if mr.verifyOnRead && newPos == 0 && mr.checksumAlgo != ChecksumNone {
+		h, err := newChecksumHash(mr.checksumAlgo)
+		if err != nil {
+			return 0, err
+		}
+		mr.mr = io.TeeReader(mr.mr, h)
+		mr.verifyHash = h
+	}
+
+	return newPos, nil
 }
 
 type options struct {
@@ -224,6 +646,39 @@ type options struct {
 	memBytes int64
 
 	maxSizeBytes int64
+
+	// pool, when set via WithPool, pages the mem segment instead of growing one contiguous slice.
+	pool *Pool
+
+	// checksumAlgo, when set via WithChecksum, is computed over the input while buffering.
+	checksumAlgo ChecksumAlgo
+	// verifyOnRead, when set via WithVerifyOnRead, re-verifies checksumAlgo on a full read from the start.
+	verifyOnRead bool
+
+	// storage creates the spill destination used once the in-memory budget is exhausted. Defaults to
+	// DirStorage("", "multibuf-"), matching the package's original behaviour of spilling to a temp
+	// file in the default directory for temporary files.
+	storage Storage
+}
+
+// clampMemBytes restores the default in-memory budget when MemBytes(0) was passed, and keeps the
+// in-memory budget within the overall size limit, so a caller that sets MaxBytes below MemBytes
+// doesn't buffer more in RAM than it's ever allowed to hold in total.
+func (o *options) clampMemBytes() {
+	if o.memBytes == 0 {
+		o.memBytes = DefaultMemBytes
+	}
+	if o.maxSizeBytes > 0 && o.maxSizeBytes < o.memBytes {
+		o.memBytes = o.maxSizeBytes
+	}
+}
+
+// validate rejects option combinations that can't be satisfied, such as WithVerifyOnRead without WithChecksum.
+func (o *options) validate() error {
+	if o.verifyOnRead && o.checksumAlgo == ChecksumNone {
+		return fmt.Errorf("WithVerifyOnRead requires WithChecksum")
+	}
+	return nil
 }
 
 type optionSetter func(o *options) error
@@ -247,3 +702,193 @@ func (r *maxReader) Read(p []byte) (int, error) {
 	}
 	return readBytes, err
 }
+
+const (
+	writerInit = iota
+	writerMem
+	writerFile
+	writerCalledRead
+)
+
+// writerOnce buffers writes in memory up to o.memBytes and then spills the remainder to o.storage,
+// mirroring the mem+file split New performs up front. Once Reader has been called the writer is spent:
+// further Write or Reader calls return ErrReaderHasBeenCalled.
+type writerOnce struct {
+	o     options
+	state int
+	// mem is a *bytes.Buffer by default, or a *poolBuffer when o.pool is set.
+	mem       io.Writer
+	spill     io.ReadWriteSeeker
+	total     int64
+	cleanupFn cleanupFunc
+	// csHash, set when o.checksumAlgo is configured, hashes every byte written regardless of
+	// whether it ends up in mem or on disk.
+	csHash hash.Hash
+}
+
+// memSegment turns the mem accumulator into the read-seekable segment newBuf expects.
+func memSegment(mem io.Writer) (io.ReadSeeker, error) {
+	switch m := mem.(type) {
+	case *poolBuffer:
+		if _, err := m.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case *bytes.Buffer:
+		return newMemBytes(m.Bytes()), nil
+	default:
+		return nil, fmt.Errorf("writerOnce: unsupported mem type %T", mem)
+	}
+}
+
+// writeToMem returns how many leading bytes of p can still be buffered in memory.
+func (w *writerOnce) writeToMem(p []byte) int {
+	left := w.o.memBytes - w.total
+	if left <= 0 {
+		return 0
+	}
+	if int64(len(p)) < left {
+		return len(p)
+	}
+	return int(left)
+}
+
+func (w *writerOnce) Write(p []byte) (int, error) {
+	if w.state == writerCalledRead {
+		return 0, ErrReaderHasBeenCalled
+	}
+	if w.o.maxSizeBytes > 0 && w.total+int64(len(p)) > w.o.maxSizeBytes {
+		return 0, &MaxSizeReachedError{MaxSize: w.o.maxSizeBytes}
+	}
+	if w.csHash != nil {
+		w.csHash.Write(p)
+	}
+
+	switch w.state {
+	case writerInit:
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if w.o.pool != nil {
+			w.mem = newPoolBuffer(w.o.pool)
+		} else {
+			w.mem = &bytes.Buffer{}
+		}
+		w.state = writerMem
+		fallthrough
+	case writerMem:
+		toMem := w.writeToMem(p)
+		if toMem > 0 {
+			wrote, err := w.mem.Write(p[:toMem])
+			w.total += int64(wrote)
+			if err != nil {
+				return wrote, err
+			}
+		}
+		left := p[toMem:]
+		if len(left) == 0 {
+			return len(p), nil
+		}
+		// Memory budget is exhausted, the rest of this and any further write goes to disk.
+		if err := w.initSpill(); err != nil {
+			return toMem, err
+		}
+		w.state = writerFile
+		wrote, err := w.spill.Write(left)
+		w.total += int64(wrote)
+		return toMem + wrote, err
+	case writerFile:
+		wrote, err := w.spill.Write(p)
+		w.total += int64(wrote)
+		return wrote, err
+	}
+	return 0, fmt.Errorf("writerOnce: unsupported state: %d", w.state)
+}
+
+func (w *writerOnce) initSpill() error {
+	spill, cleanup, err := w.o.storage.Create()
+	if err != nil {
+		return err
+	}
+	w.spill = spill
+	w.cleanupFn = cleanup
+	return nil
+}
+
+func (w *writerOnce) Close() error {
+	if pb, ok := w.mem.(*poolBuffer); ok {
+		pb.Close()
+	}
+	if w.cleanupFn != nil {
+		return w.cleanupFn()
+	}
+	return nil
+}
+
+func (w *writerOnce) Reader() (MultiBuf, error) {
+	switch w.state {
+	case writerInit:
+		return nil, ErrNoDataReady
+	case writerCalledRead:
+		return nil, ErrReaderHasBeenCalled
+	case writerMem:
+		seg, err := memSegment(w.mem)
+		if err != nil {
+			return nil, err
+		}
+		var memShared *sharedCloser
+		var cleanupFns []func() error
+		if pb, ok := w.mem.(*poolBuffer); ok {
+			memShared = newSharedCloser(pb.Close)
+			cleanupFns = append(cleanupFns, memShared.release)
+		}
+		w.state = writerCalledRead
+		w.mem = nil
+		mb := newBuf(w.total, combineCleanup(cleanupFns), seg)
+		mb.memSrc = seg.(memSource)
+		mb.memShared = memShared
+		w.setChecksum(mb)
+		return mb, nil
+	case writerFile:
+		seg, err := memSegment(w.mem)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.spill.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// Reader now owns the mem segment and spill, Close will no longer touch them.
+		pb, isPool := w.mem.(*poolBuffer)
+		spill, spillCleanup := w.spill, w.cleanupFn
+		var memShared *sharedCloser
+		var cleanupFns []func() error
+		if isPool {
+			memShared = newSharedCloser(pb.Close)
+			cleanupFns = append(cleanupFns, memShared.release)
+		}
+		var spillShared *sharedCloser
+		if spillCleanup != nil {
+			spillShared = newSharedCloser(spillCleanup)
+			cleanupFns = append(cleanupFns, spillShared.release)
+		}
+		w.state = writerCalledRead
+		w.mem, w.spill, w.cleanupFn = nil, nil, nil
+		mb := newBuf(w.total, combineCleanup(cleanupFns), seg, spill)
+		mb.memSrc = seg.(memSource)
+		mb.spill = spill
+		mb.spillShared = spillShared
+		mb.memShared = memShared
+		w.setChecksum(mb)
+		return mb, nil
+	}
+	return nil, fmt.Errorf("writerOnce: unsupported state: %d", w.state)
+}
+
+// setChecksum copies the checksum computed while writing, if any, onto mb.
+func (w *writerOnce) setChecksum(mb *multiReaderSeek) {
+	mb.checksumAlgo = w.o.checksumAlgo
+	mb.verifyOnRead = w.o.verifyOnRead
+	if w.csHash != nil {
+		mb.checksum = w.csHash.Sum(nil)
+	}
+}
@@ -38,6 +38,20 @@ func hashOfReader(r io.Reader) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+func randomBytes(size int64) []byte {
+	f, err := os.Open("/dev/urandom")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	b := make([]byte, int(size))
+	if _, err := io.ReadFull(f, b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func TestSmallBuffer(t *testing.T) {
 	r, hash := createReaderOfSize(1)
 	bb, err := New(r)
@@ -110,6 +124,105 @@ func TestSeekFirst(t *testing.T) {
 	assert.Equal(t, tlen, l)
 }
 
+func TestSeekOffsetMemOnly(t *testing.T) {
+	b := randomBytes(1057576)
+	bb, err := New(bytes.NewReader(b))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	pos, err := bb.Seek(100, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[100:], out)
+}
+
+func TestSeekOffsetFileOnly(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	pos, err := bb.Seek(200, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[200:], out)
+}
+
+func TestSeekOffsetStraddlesBoundary(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	pos, err := bb.Seek(50, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[50:], out)
+}
+
+func TestSeekCurrentAndEnd(t *testing.T) {
+	b := randomBytes(1000)
+	bb, err := New(bytes.NewReader(b))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, err = bb.Seek(100, io.SeekStart)
+	assert.NoError(t, err)
+
+	pos, err := bb.Seek(50, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[150:], out)
+
+	pos, err = bb.Seek(-10, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(990), pos)
+
+	out, err = ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[990:], out)
+}
+
+func TestSeekToSizeReturnsEOF(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	size, err := bb.Size()
+	assert.NoError(t, err)
+
+	pos, err := bb.Seek(size, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, size, pos)
+
+	n, err := bb.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSeekNegativeIsRejected(t *testing.T) {
+	b := randomBytes(100)
+	bb, err := New(bytes.NewReader(b))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, err = bb.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
+
 func TestLimitDoesNotExceed(t *testing.T) {
 	requestSize := int64(1057576)
 	r, hash := createReaderOfSize(requestSize)
@@ -228,7 +341,7 @@ func TestWriterOncePartialWrites(t *testing.T) {
 	bb, err := w.Reader()
 	assert.NoError(t, err)
 	assert.Nil(t, w.(*writerOnce).mem)
-	assert.Nil(t, w.(*writerOnce).file)
+	assert.Nil(t, w.(*writerOnce).spill)
 
 	assert.Equal(t, hash, hashOfReader(bb))
 	bb.Close()
@@ -246,6 +359,18 @@ func TestWriterOnceMaxSizeExceeded(t *testing.T) {
 	assert.NoError(t, w.Close())
 }
 
+func TestWriterOnceZeroLengthWriteLeavesNoDataReady(t *testing.T) {
+	w, err := NewWriterOnce()
+	assert.NoError(t, err)
+
+	n, err := w.Write([]byte{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = w.Reader()
+	assert.Equal(t, ErrNoDataReady, err)
+}
+
 func TestWriterReaderCalled(t *testing.T) {
 	size := int64(1000)
 	r, hash := createReaderOfSize(size)
@@ -0,0 +1,56 @@
+package multibuf
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/minio/highwayhash"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ChecksumAlgo identifies a supported checksum algorithm for WithChecksum.
+type ChecksumAlgo int
+
+const (
+	// ChecksumNone means no checksum was configured; it is the zero value of ChecksumAlgo.
+	ChecksumNone ChecksumAlgo = iota
+	SHA256
+	BLAKE2b_256
+	HighwayHash256
+)
+
+func (a ChecksumAlgo) String() string {
+	switch a {
+	case ChecksumNone:
+		return "none"
+	case SHA256:
+		return "sha256"
+	case BLAKE2b_256:
+		return "blake2b-256"
+	case HighwayHash256:
+		return "highwayhash-256"
+	default:
+		return fmt.Sprintf("ChecksumAlgo(%d)", int(a))
+	}
+}
+
+// highwayHashKey is the fixed key HighwayHash256 checksums are computed with. HighwayHash requires a
+// key, but this package uses it purely as a fast integrity check rather than a MAC, so a constant,
+// publicly known key is fine; it is never meant to authenticate the data against a third party.
+var highwayHashKey = sha256.Sum256([]byte("mailgun/multibuf highwayhash checksum key"))
+
+// newChecksumHash returns a fresh hash.Hash for algo. algo must be one of the non-zero ChecksumAlgo
+// values; WithChecksum is the only place that should produce such a value.
+func newChecksumHash(algo ChecksumAlgo) (hash.Hash, error) {
+	switch algo {
+	case SHA256:
+		return sha256.New(), nil
+	case BLAKE2b_256:
+		return blake2b.New256(nil)
+	case HighwayHash256:
+		return highwayhash.New(highwayHashKey[:])
+	default:
+		return nil, fmt.Errorf("multibuf: unsupported checksum algorithm %v", algo)
+	}
+}
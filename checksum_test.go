@@ -0,0 +1,124 @@
+package multibuf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	for _, algo := range []ChecksumAlgo{SHA256, BLAKE2b_256, HighwayHash256} {
+		b := randomBytes(1000)
+		h, err := newChecksumHash(algo)
+		assert.NoError(t, err)
+		h.Write(b)
+		want := h.Sum(nil)
+
+		bb, err := New(bytes.NewReader(b), WithChecksum(algo))
+		assert.NoError(t, err)
+		defer bb.Close()
+
+		sum, gotAlgo, err := bb.Sum()
+		assert.NoError(t, err)
+		assert.Equal(t, algo, gotAlgo)
+		assert.Equal(t, want, sum)
+	}
+}
+
+func TestChecksumCoversFileSpill(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	h, err := newChecksumHash(SHA256)
+	assert.NoError(t, err)
+	h.Write(b)
+	want := h.Sum(nil)
+
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithChecksum(SHA256))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	sum, _, err := bb.Sum()
+	assert.NoError(t, err)
+	assert.Equal(t, want, sum)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestSumWithoutChecksumIsAnError(t *testing.T) {
+	bb, err := New(bytes.NewReader(randomBytes(10)))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, _, err = bb.Sum()
+	assert.Equal(t, ErrNoChecksum, err)
+}
+
+func TestWithVerifyOnReadRequiresChecksum(t *testing.T) {
+	_, err := New(bytes.NewReader(randomBytes(10)), WithVerifyOnRead(true))
+	assert.Error(t, err)
+
+	_, err = NewWriterOnce(WithVerifyOnRead(true))
+	assert.Error(t, err)
+}
+
+func TestVerifyOnReadDetectsBitrot(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithChecksum(SHA256), WithVerifyOnRead(true))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	mr, ok := bb.(*multiReaderSeek)
+	assert.True(t, ok)
+	f, ok := mr.spill.(*os.File)
+	assert.True(t, ok)
+	_, err = f.WriteAt([]byte{0xff}, 10)
+	assert.NoError(t, err)
+
+	_, err = bb.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+
+	_, err = ioutil.ReadAll(bb)
+	assert.Equal(t, ErrBitrot, err)
+}
+
+func TestVerifyOnReadPassesForUnmodifiedData(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithChecksum(SHA256), WithVerifyOnRead(true))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, err = bb.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestWriterOnceChecksum(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	h, err := newChecksumHash(SHA256)
+	assert.NoError(t, err)
+	h.Write(b)
+	want := h.Sum(nil)
+
+	w, err := NewWriterOnce(MemBytes(100), WithChecksum(SHA256))
+	assert.NoError(t, err)
+
+	_, err = w.Write(b)
+	assert.NoError(t, err)
+
+	bb, err := w.Reader()
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	sum, algo, err := bb.Sum()
+	assert.NoError(t, err)
+	assert.Equal(t, SHA256, algo)
+	assert.Equal(t, want, sum)
+}
@@ -0,0 +1,49 @@
+package multibuf
+
+import (
+	"io"
+	"os"
+)
+
+// fileCursor is an independent read/seek cursor over a shared *os.File, used by NewReader to fan a
+// disk-spilled buffer out to concurrent readers. Duplicating a file descriptor (dup(2) on Unix) or
+// handle (DuplicateHandle on Windows) does not give the duplicate its own file offset: both still
+// share the single underlying open file description/object, so two readers seeking and reading
+// concurrently through "independent" dups would race on one cursor. fileCursor sidesteps the whole
+// problem: it reads with (*os.File).ReadAt, a positioned read that ignores the file's shared offset
+// on every platform Go supports, and tracks its own logical position locally, the same way
+// pagedCursor gives concurrent readers of a pool-backed mem segment their own position over shared
+// pages.
+type fileCursor struct {
+	f   *os.File
+	pos int64
+}
+
+func (c *fileCursor) Read(p []byte) (int, error) {
+	n, err := c.f.ReadAt(p, c.pos)
+	c.pos += int64(n)
+	return n, err
+}
+
+func (c *fileCursor) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = c.pos + offset
+	case io.SeekEnd:
+		info, err := c.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		newPos = info.Size() + offset
+	default:
+		return 0, errUnsupportedWhence
+	}
+	if newPos < 0 {
+		return 0, errNegativeSeek
+	}
+	c.pos = newPos
+	return newPos, nil
+}
@@ -0,0 +1,50 @@
+package multibuf
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFileCursorIndependentOffsets verifies that two fileCursors sharing one *os.File do not share
+// a position: interleaving reads through both must not interleave the bytes each one sees, which is
+// exactly what plain dup(2)/DuplicateHandle fail to guarantee since those share the underlying open
+// file description/object.
+func TestFileCursorIndependentOffsets(t *testing.T) {
+	f, err := ioutil.TempFile("", "multibuf-filecursor-")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	b := randomBytes(100)
+	_, err = f.Write(b)
+	assert.NoError(t, err)
+
+	a := &fileCursor{f: f}
+	c := &fileCursor{f: f}
+
+	// Advance a by 10 bytes, then read a chunk from c at the start: a's position must be untouched.
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(a, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b[:10], buf)
+
+	_, err = io.ReadFull(c, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b[:10], buf)
+
+	// a continues from byte 10, unaffected by c's read.
+	_, err = io.ReadFull(a, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b[10:20], buf)
+
+	// Seeking c does not move a.
+	_, err = c.Seek(50, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(a, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b[20:30], buf)
+}
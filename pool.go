@@ -0,0 +1,135 @@
+package multibuf
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultPageSize is the page size used by NewPool, modelled on the page size rclone's pool package
+// defaults to: big enough to amortise syscall and GC overhead, small enough to keep steady-state memory
+// bounded when many buffers are alive at once.
+const DefaultPageSize = 65536
+
+// Pool is a sync.Pool of fixed-size byte pages. Passing a Pool to New or NewWriterOnce via WithPool
+// makes the in-memory portion of the buffer grow page by page instead of via a single, repeatedly
+// reallocated contiguous slice, which keeps amortised allocation O(1) per buffer for callers that
+// buffer many requests concurrently.
+type Pool struct {
+	pageSize int
+	pool     sync.Pool
+}
+
+// NewPool creates a Pool handing out pages of pageSize bytes. A pageSize <= 0 uses DefaultPageSize.
+func NewPool(pageSize int) *Pool {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	p := &Pool{pageSize: pageSize}
+	p.pool.New = func() interface{} {
+		return make([]byte, p.pageSize)
+	}
+	return p
+}
+
+func (p *Pool) get() []byte {
+	return p.pool.Get().([]byte)
+}
+
+func (p *Pool) put(page []byte) {
+	p.pool.Put(page[:cap(page)])
+}
+
+// pagedCursor is a read/seek cursor over a sequence of fixed-size pages. Several pagedCursors can
+// share the same pages slice, each with its own pos, which is what lets poolBuffer hand out
+// independent readers over data it has already buffered. Reads and seeks translate an absolute
+// offset into (pageIdx, pageOffset) via idx / pageSize and idx % pageSize; the last page is clipped
+// to lastOffset, the number of bytes actually used in it.
+type pagedCursor struct {
+	pageSize   int
+	pages      [][]byte
+	lastOffset int
+	pos        int64
+}
+
+// Size returns the total number of bytes available across all pages.
+func (c *pagedCursor) Size() int64 {
+	if len(c.pages) == 0 {
+		return 0
+	}
+	return int64(len(c.pages)-1)*int64(c.pageSize) + int64(c.lastOffset)
+}
+
+func (c *pagedCursor) Read(p []byte) (int, error) {
+	if c.pos >= c.Size() {
+		return 0, io.EOF
+	}
+	pageIdx, pageOffset := int(c.pos/int64(c.pageSize)), int(c.pos%int64(c.pageSize))
+	page := c.pages[pageIdx]
+	if pageIdx == len(c.pages)-1 {
+		page = page[:c.lastOffset]
+	}
+	n := copy(p, page[pageOffset:])
+	c.pos += int64(n)
+	return n, nil
+}
+
+func (c *pagedCursor) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = c.pos + offset
+	case io.SeekEnd:
+		newPos = c.Size() + offset
+	default:
+		return 0, errUnsupportedWhence
+	}
+	if newPos < 0 {
+		return 0, errNegativeSeek
+	}
+	c.pos = newPos
+	return newPos, nil
+}
+
+// poolBuffer accumulates writes as a sequence of pages leased from a Pool and implements
+// io.ReadWriteSeeker over them, so it can stand in for the *bytes.Reader mem segment of a
+// multiReaderSeek.
+type poolBuffer struct {
+	pool *Pool
+	*pagedCursor
+}
+
+func newPoolBuffer(pool *Pool) *poolBuffer {
+	return &poolBuffer{pool: pool, pagedCursor: &pagedCursor{pageSize: pool.pageSize}}
+}
+
+func (b *poolBuffer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(b.pages) == 0 || b.lastOffset == b.pageSize {
+			b.pages = append(b.pages, b.pool.get())
+			b.lastOffset = 0
+		}
+		n := copy(b.pages[len(b.pages)-1][b.lastOffset:], p)
+		b.lastOffset += n
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// newReader returns an independent cursor over the pages written so far, sharing them read-only.
+// Used by multiReaderSeek.NewReader to fan out a pool-backed mem segment to concurrent readers.
+func (b *poolBuffer) newReader() io.ReadSeeker {
+	return &pagedCursor{pageSize: b.pageSize, pages: b.pages, lastOffset: b.lastOffset}
+}
+
+// Close returns every leased page to the pool. poolBuffer must not be used afterwards.
+func (b *poolBuffer) Close() error {
+	for _, page := range b.pages {
+		b.pool.put(page)
+	}
+	b.pages = nil
+	return nil
+}
@@ -0,0 +1,110 @@
+package multibuf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolSmallBuffer(t *testing.T) {
+	b := randomBytes(1)
+	pool := NewPool(16)
+	bb, err := New(bytes.NewReader(b), WithPool(pool))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestPoolBufferSpansMultiplePages(t *testing.T) {
+	pageSize := 16
+	b := randomBytes(int64(pageSize*3 + 5))
+	pool := NewPool(pageSize)
+	bb, err := New(bytes.NewReader(b), WithPool(pool), MemBytes(int64(len(b))))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestPoolBufferSeek(t *testing.T) {
+	pageSize := 16
+	b := randomBytes(int64(pageSize*3 + 5))
+	pool := NewPool(pageSize)
+	bb, err := New(bytes.NewReader(b), WithPool(pool), MemBytes(int64(len(b))))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	off := int64(pageSize + 3)
+	pos, err := bb.Seek(off, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, off, pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[off:], out)
+}
+
+func TestPoolBufferWithFileSpill(t *testing.T) {
+	pool := NewPool(16)
+	b := randomBytes(1000)
+	bb, err := New(bytes.NewReader(b), WithPool(pool), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestPoolReturnsPagesOnClose(t *testing.T) {
+	pool := NewPool(16)
+	b := randomBytes(100)
+	bb, err := New(bytes.NewReader(b), WithPool(pool))
+	assert.NoError(t, err)
+	assert.NoError(t, bb.Close())
+
+	// The pool must have pages available to reuse without allocating new ones.
+	page := pool.get()
+	assert.Len(t, page, 16)
+	pool.put(page)
+}
+
+func TestPoolReturnsPagesWhenSpillFails(t *testing.T) {
+	pool := NewPool(16)
+	b := randomBytes(100)
+	_, err := New(bytes.NewReader(b), WithPool(pool), MemBytes(10), WithStorage(MemOnlyStorage{}))
+	assert.Equal(t, ErrSpillForbidden, err)
+
+	// New must release the pages it had already leased for the mem segment before returning the
+	// error, so they're available for reuse without allocating new ones.
+	page := pool.get()
+	assert.Len(t, page, 16)
+	pool.put(page)
+}
+
+func TestWriterOnceWithPool(t *testing.T) {
+	pool := NewPool(16)
+	b := randomBytes(1000)
+
+	w, err := NewWriterOnce(WithPool(pool), MemBytes(100))
+	assert.NoError(t, err)
+
+	_, err = io.Copy(w, bytes.NewReader(b))
+	assert.NoError(t, err)
+
+	bb, err := w.Reader()
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
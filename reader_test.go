@@ -0,0 +1,113 @@
+package multibuf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fanOutAndHash spins up concurrency goroutines, each obtaining its own reader via NewReader and
+// reading it to completion, and returns the md5 hash each goroutine computed.
+func fanOutAndHash(t *testing.T, bb MultiBuf, concurrency int) []string {
+	hashes := make([]string, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := bb.NewReader()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer r.Close()
+			hashes[i] = hashOfReader(r)
+		}(i)
+	}
+	wg.Wait()
+	return hashes
+}
+
+func TestNewReaderMemOnly(t *testing.T) {
+	b := randomBytes(1000)
+	bb, err := New(bytes.NewReader(b))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	want := hashOfReader(bytes.NewReader(b))
+	for i, got := range fanOutAndHash(t, bb, 8) {
+		assert.Equal(t, want, got, "reader %d", i)
+	}
+
+	// The original buffer is unaffected by the independent readers.
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestNewReaderWithFileSpill(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	want := hashOfReader(bytes.NewReader(b))
+	for i, got := range fanOutAndHash(t, bb, 8) {
+		assert.Equal(t, want, got, "reader %d", i)
+	}
+}
+
+func TestNewReaderWithPool(t *testing.T) {
+	pool := NewPool(16)
+	b := randomBytes(1000)
+	bb, err := New(bytes.NewReader(b), WithPool(pool), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	want := hashOfReader(bytes.NewReader(b))
+	for i, got := range fanOutAndHash(t, bb, 8) {
+		assert.Equal(t, want, got, "reader %d", i)
+	}
+}
+
+func TestNewReaderFromWriterOnce(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	w, err := NewWriterOnce(MemBytes(100))
+	assert.NoError(t, err)
+
+	_, err = w.Write(b)
+	assert.NoError(t, err)
+
+	bb, err := w.Reader()
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	want := hashOfReader(bytes.NewReader(b))
+	for i, got := range fanOutAndHash(t, bb, 8) {
+		assert.Equal(t, want, got, "reader %d", i)
+	}
+}
+
+// TestNewReaderFileClosesIndependently verifies that closing one reader does not affect a sibling
+// reader spun up from the same MultiBuf: each reader has its own offset into the shared file, which
+// stays open until every reader sharing it has been closed.
+func TestNewReaderFileClosesIndependently(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	r1, err := bb.NewReader()
+	assert.NoError(t, err)
+	r2, err := bb.NewReader()
+	assert.NoError(t, err)
+
+	assert.NoError(t, r1.Close())
+
+	out, err := ioutil.ReadAll(r2)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+	assert.NoError(t, r2.Close())
+}
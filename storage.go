@@ -0,0 +1,172 @@
+package multibuf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+)
+
+// Storage creates the destination New and NewWriterOnce spill to once a buffer's in-memory budget
+// is exhausted. Create returns a fresh, empty read-write-seekable destination together with a
+// cleanup function that releases it; cleanup is invoked once, when the MultiBuf that spilled to it
+// and every MultiBuf created from it with NewReader have all been closed, or earlier if New fails
+// after the destination was created.
+type Storage interface {
+	Create() (io.ReadWriteSeeker, func() error, error)
+}
+
+// dirStorage spills to a temp file created with ioutil.TempFile(dir, prefix), unlinked immediately
+// so its storage is reclaimed by the OS as soon as every handle to it is closed.
+type dirStorage struct {
+	dir    string
+	prefix string
+}
+
+// DirStorage returns a Storage that spills to a temp file in dir (os.TempDir() if dir is empty)
+// named with prefix. This is the default Storage used by New and NewWriterOnce.
+func DirStorage(dir, prefix string) Storage {
+	return &dirStorage{dir: dir, prefix: prefix}
+}
+
+func (s *dirStorage) Create() (io.ReadWriteSeeker, func() error, error) {
+	file, err := ioutil.TempFile(s.dir, s.prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	os.Remove(file.Name())
+	return file, file.Close, nil
+}
+
+// ErrSpillForbidden is returned by MemOnlyStorage.Create, and so from New, or from a WriterOnce's
+// Write, once a buffer configured with it exceeds its in-memory budget.
+var ErrSpillForbidden = errors.New("mailgun/multibuf: buffer exceeded its in-memory budget and MemOnlyStorage forbids spilling to disk")
+
+// MemOnlyStorage rejects any attempt to spill to disk, for callers that would rather fail than ever
+// buffer a payload outside of RAM. Pair it with MaxBytes to bound memory use instead.
+type MemOnlyStorage struct{}
+
+func (MemOnlyStorage) Create() (io.ReadWriteSeeker, func() error, error) {
+	return nil, nil, ErrSpillForbidden
+}
+
+// EncryptedStorage wraps another Storage, encrypting everything written to it with AES-CTR under
+// Key (which must be 16, 24 or 32 bytes, selecting AES-128/192/256) so the spilled data is
+// unreadable to anything with access to the underlying storage but not Key.
+type EncryptedStorage struct {
+	Inner Storage
+	Key   []byte
+}
+
+func (s EncryptedStorage) Create() (io.ReadWriteSeeker, func() error, error) {
+	block, err := aes.NewCipher(s.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inner, cleanup, err := s.Inner.Create()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := inner.Write(iv); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return &ctrReadWriteSeeker{inner: inner, block: block, iv: iv}, cleanup, nil
+}
+
+// ctrReadWriteSeeker encrypts/decrypts an inner io.ReadWriteSeeker with AES-CTR. The first
+// aes.BlockSize bytes of inner store the IV in the clear; every position is translated by that
+// header size before reaching inner. CTR's keystream at any block is independent of the ones
+// before it, which is what makes this seekable: streamAt reconstructs the keystream for an
+// arbitrary byte offset by advancing the counter by offset/aes.BlockSize blocks and discarding
+// offset%aes.BlockSize keystream bytes, rather than requiring the stream to be read from the start.
+type ctrReadWriteSeeker struct {
+	inner io.ReadWriteSeeker
+	block cipher.Block
+	iv    []byte
+	pos   int64
+}
+
+func (s *ctrReadWriteSeeker) streamAt(pos int64) cipher.Stream {
+	counter := make([]byte, len(s.iv))
+	copy(counter, s.iv)
+	addCounter(counter, pos/int64(aes.BlockSize))
+
+	stream := cipher.NewCTR(s.block, counter)
+	if skip := int(pos % int64(aes.BlockSize)); skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	return stream
+}
+
+func (s *ctrReadWriteSeeker) Read(p []byte) (int, error) {
+	n, err := s.inner.Read(p)
+	if n > 0 {
+		s.streamAt(s.pos).XORKeyStream(p[:n], p[:n])
+		s.pos += int64(n)
+	}
+	return n, err
+}
+
+func (s *ctrReadWriteSeeker) Write(p []byte) (int, error) {
+	ciphertext := make([]byte, len(p))
+	s.streamAt(s.pos).XORKeyStream(ciphertext, p)
+	n, err := s.inner.Write(ciphertext)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *ctrReadWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = s.pos + offset
+	case io.SeekEnd:
+		innerSize, err := s.inner.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		newPos = innerSize - int64(len(s.iv)) + offset
+	default:
+		return 0, errUnsupportedWhence
+	}
+	if newPos < 0 {
+		return 0, errNegativeSeek
+	}
+	if _, err := s.inner.Seek(newPos+int64(len(s.iv)), io.SeekStart); err != nil {
+		return 0, err
+	}
+	s.pos = newPos
+	return newPos, nil
+}
+
+// addCounter adds delta to ctr, treated as a big-endian unsigned integer of len(ctr) bytes, wrapping
+// on overflow the same way the CTR block counter itself wraps.
+func addCounter(ctr []byte, delta int64) {
+	n := new(big.Int).SetBytes(ctr)
+	n.Add(n, big.NewInt(delta))
+
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(len(ctr)*8))
+	n.Mod(n, mod)
+
+	b := n.Bytes()
+	for i := range ctr {
+		ctr[i] = 0
+	}
+	copy(ctr[len(ctr)-len(b):], b)
+}
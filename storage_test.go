@@ -0,0 +1,162 @@
+package multibuf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirStorageIsDefault(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	bb, err := New(bytes.NewReader(b), MemBytes(100))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestMemOnlyStorageForbidsSpill(t *testing.T) {
+	b := randomBytes(1000)
+	_, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(MemOnlyStorage{}))
+	assert.Equal(t, ErrSpillForbidden, err)
+}
+
+func TestMemOnlyStorageAllowsWithinBudget(t *testing.T) {
+	b := randomBytes(100)
+	bb, err := New(bytes.NewReader(b), MemBytes(1000), WithStorage(MemOnlyStorage{}))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestEncryptedStorageRoundTrips(t *testing.T) {
+	key := randomBytes(32)
+	b := randomBytes(DefaultMemBytes + 1000)
+	storage := EncryptedStorage{Inner: DirStorage("", "multibuf-"), Key: key}
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(storage))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+func TestEncryptedStorageSeek(t *testing.T) {
+	key := randomBytes(32)
+	b := randomBytes(DefaultMemBytes + 1000)
+	storage := EncryptedStorage{Inner: DirStorage("", "multibuf-"), Key: key}
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(storage))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	off := int64(DefaultMemBytes + 37)
+	pos, err := bb.Seek(off, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, off, pos)
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b[off:], out)
+}
+
+// capturingStorage wraps another Storage and remembers the raw destination it created, so a test can
+// inspect it directly - bypassing EncryptedStorage's decrypting wrapper, which is what a normal
+// caller reading back through the returned MultiBuf would go through instead.
+type capturingStorage struct {
+	inner   Storage
+	created io.ReadWriteSeeker
+}
+
+func (c *capturingStorage) Create() (io.ReadWriteSeeker, func() error, error) {
+	rws, cleanup, err := c.inner.Create()
+	c.created = rws
+	return rws, cleanup, err
+}
+
+func TestEncryptedStorageDoesNotLeakPlaintextOnDisk(t *testing.T) {
+	key := randomBytes(32)
+	b := bytes.Repeat([]byte("plaintext-marker"), 1000)
+	cap := &capturingStorage{inner: DirStorage("", "multibuf-")}
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(EncryptedStorage{Inner: cap, Key: key}))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, err = cap.created.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	raw, err := ioutil.ReadAll(cap.created)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "plaintext-marker")
+}
+
+func TestWriterOnceWithStorage(t *testing.T) {
+	key := randomBytes(32)
+	b := randomBytes(DefaultMemBytes + 1000)
+	storage := EncryptedStorage{Inner: DirStorage("", "multibuf-"), Key: key}
+
+	w, err := NewWriterOnce(MemBytes(100), WithStorage(storage))
+	assert.NoError(t, err)
+
+	_, err = w.Write(b)
+	assert.NoError(t, err)
+
+	bb, err := w.Reader()
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	out, err := ioutil.ReadAll(bb)
+	assert.NoError(t, err)
+	assert.Equal(t, b, out)
+}
+
+// seekFailingStorage wraps another Storage and makes every Seek on the destination it creates fail,
+// simulating a custom Storage backend whose Seek can genuinely fail (unlike the hard-coded *os.File
+// New used to spill to).
+type seekFailingStorage struct {
+	inner Storage
+}
+
+func (s seekFailingStorage) Create() (io.ReadWriteSeeker, func() error, error) {
+	rws, cleanup, err := s.inner.Create()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &seekFailingReadWriteSeeker{ReadWriteSeeker: rws}, cleanup, nil
+}
+
+type seekFailingReadWriteSeeker struct {
+	io.ReadWriteSeeker
+}
+
+var errSeekFailed = errors.New("multibuf: seek failed")
+
+func (s *seekFailingReadWriteSeeker) Seek(int64, int) (int64, error) {
+	return 0, errSeekFailed
+}
+
+func TestNewReturnsErrorWhenSpillSeekFails(t *testing.T) {
+	b := randomBytes(DefaultMemBytes + 1000)
+	_, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(seekFailingStorage{inner: DirStorage("", "multibuf-")}))
+	assert.Equal(t, errSeekFailed, err)
+}
+
+func TestEncryptedStorageNewReaderIsUnsupported(t *testing.T) {
+	key := randomBytes(32)
+	b := randomBytes(DefaultMemBytes + 1000)
+	storage := EncryptedStorage{Inner: DirStorage("", "multibuf-"), Key: key}
+	bb, err := New(bytes.NewReader(b), MemBytes(100), WithStorage(storage))
+	assert.NoError(t, err)
+	defer bb.Close()
+
+	_, err = bb.NewReader()
+	assert.Equal(t, errNewReaderRequiresFileStorage, err)
+}